@@ -0,0 +1,328 @@
+// Copyright 2018 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/mitchellh/mapstructure"
+	"gopkg.in/yaml.v2"
+
+	"github.com/gohugoio/hugo/cache/namedmemcache"
+	"github.com/gohugoio/hugo/common/maps"
+	"github.com/gohugoio/hugo/deps"
+	"github.com/gohugoio/hugo/media"
+	"github.com/gohugoio/hugo/resource"
+)
+
+// New returns a new instance of the transform-namespaced template functions.
+func New(deps *deps.Deps) *Namespace {
+	return &Namespace{
+		deps:  deps,
+		cache: namedmemcache.New(),
+	}
+}
+
+// Namespace provides template functions for the "transform" namespace.
+type Namespace struct {
+	deps  *deps.Deps
+	cache *namedmemcache.Cache
+}
+
+// unmarshalOptions holds the options supported across the various formats
+// handled by Unmarshal. Not every option applies to every format; unused
+// options are simply ignored by the decoder for that format.
+type unmarshalOptions struct {
+	// CSV
+	Delimiter string
+	Comment   string
+
+	// Calendar (iCalendar/vCard)
+	Location        string
+	ExpandRecurring bool
+	WindowEnd       string
+
+	// XML
+	AttributePrefix string
+	TextKey         string
+	ForceList       []string
+
+	// Validation: a JSON Schema or Rego policy, as a string, a Resource
+	// or an already-decoded map. Left untyped since mapstructure should
+	// pass it through verbatim rather than try to coerce it.
+	Schema interface{}
+}
+
+func decodeOptions(m map[string]interface{}) (unmarshalOptions, error) {
+	opts := unmarshalOptions{
+		Delimiter:       ",",
+		Location:        "UTC",
+		AttributePrefix: "@",
+		TextKey:         "#text",
+	}
+
+	if m == nil {
+		return opts, nil
+	}
+
+	if err := mapstructure.WeakDecode(m, &opts); err != nil {
+		return opts, fmt.Errorf("failed to decode unmarshal options: %s", err)
+	}
+
+	return opts, nil
+}
+
+// Unmarshal unmarshals the data given, which can be either a string or a
+// Resource. Supported formats are JSON, TOML, YAML, CSV, XML and iCalendar
+// (identified either via the MIME type of the Resource or, for plain
+// strings, sniffed from the content itself). An optional map of options
+// can be passed as the first argument.
+func (ns *Namespace) Unmarshal(args ...interface{}) (interface{}, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, errors.New("unmarshal takes 1 or 2 arguments")
+	}
+
+	var data, rawOptions interface{}
+
+	if len(args) == 1 {
+		data = args[0]
+	} else {
+		rawOptions = args[0]
+		data = args[1]
+	}
+
+	var options map[string]interface{}
+	if rawOptions != nil {
+		m, err := maps.ToStringMapE(rawOptions)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshal options must be a map: %s", err)
+		}
+		options = m
+	}
+
+	var (
+		key      string
+		mimeType media.Type
+		hasMime  bool
+		content  []byte
+	)
+
+	switch v := data.(type) {
+	case resource.ReadSeekCloserResource:
+		key = v.Key()
+		mimeType = v.MediaType()
+		hasMime = true
+		rc, err := v.ReadSeekCloser()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		b, err := ioutil.ReadAll(rc)
+		if err != nil {
+			return nil, err
+		}
+		content = b
+	case string:
+		key = md5String(v)
+		content = []byte(v)
+	default:
+		return nil, fmt.Errorf("type %T not supported, expected a string or a Resource", data)
+	}
+
+	// The cache is keyed on the source content alone, so two calls
+	// against the same data but with different options (most critically
+	// a different, or absent, "schema") must not collide and return each
+	// other's cached result.
+	if options != nil {
+		key += "/" + md5String(fmt.Sprintf("%#v", options))
+	}
+
+	return ns.cache.GetOrCreate(key, func() (interface{}, error) {
+		opts, err := decodeOptions(options)
+		if err != nil {
+			return nil, err
+		}
+
+		var decoded interface{}
+		if hasMime {
+			decoded, err = ns.unmarshalType(mimeType, content, opts)
+		} else {
+			decoded, err = ns.unmarshalSniffed(content, opts)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if opts.Schema != nil {
+			validator, err := ns.getValidator(opts.Schema)
+			if err != nil {
+				return nil, fmt.Errorf("failed to prepare schema: %s", err)
+			}
+			if err := validator.Validate(decoded); err != nil {
+				return nil, err
+			}
+		}
+
+		return decoded, nil
+	})
+}
+
+// unmarshalType decodes content according to the explicit MIME type of the
+// source Resource.
+func (ns *Namespace) unmarshalType(mimeType media.Type, content []byte, opts unmarshalOptions) (interface{}, error) {
+	switch mimeType {
+	case media.JSONType:
+		return unmarshalJSON(content)
+	case media.YAMLType:
+		return unmarshalYAML(content)
+	case media.TOMLType:
+		return unmarshalTOML(content)
+	case media.CSVType:
+		return unmarshalCSV(content, opts)
+	case media.CalendarType:
+		return unmarshalCalendar(content, opts)
+	default:
+		if isXMLType(mimeType) {
+			return unmarshalXML(content, opts)
+		}
+		return nil, fmt.Errorf("MIME type %s not supported", mimeType)
+	}
+}
+
+// isXMLType reports whether mt is XML proper or one of the common
+// XML-based feed formats (RSS, Atom) that should be decoded the same way.
+func isXMLType(mt media.Type) bool {
+	if mt == media.XMLType {
+		return true
+	}
+	return mt.SubType == "rss+xml" || mt.SubType == "atom+xml"
+}
+
+// unmarshalSniffed is used for plain strings without an associated MIME
+// type. It tries JSON, YAML and TOML in turn, expecting a map as the
+// result, then XML and iCalendar/vCard if the content looks like either,
+// and finally falls back to CSV if the content looks delimited.
+func (ns *Namespace) unmarshalSniffed(content []byte, opts unmarshalOptions) (interface{}, error) {
+	if v, err := unmarshalJSON(content); err == nil {
+		return v, nil
+	}
+
+	if v, err := unmarshalYAML(content); err == nil {
+		if _, ok := v.(map[string]interface{}); ok {
+			return v, nil
+		}
+	}
+
+	if v, err := unmarshalTOML(content); err == nil {
+		if _, ok := v.(map[string]interface{}); ok {
+			return v, nil
+		}
+	}
+
+	if looksLikeXML(content) {
+		if v, err := unmarshalXML(content, opts); err == nil {
+			return v, nil
+		}
+	}
+
+	if upper := bytes.ToUpper(bytes.TrimSpace(content)); bytes.HasPrefix(upper, []byte("BEGIN:VCALENDAR")) || bytes.HasPrefix(upper, []byte("BEGIN:VCARD")) {
+		return unmarshalCalendar(content, opts)
+	}
+
+	delimiter := opts.Delimiter
+	if delimiter == "" {
+		delimiter = ","
+	}
+	if bytes.ContainsRune(content, rune(delimiter[0])) {
+		return unmarshalCSV(content, opts)
+	}
+
+	return nil, fmt.Errorf("unable to determine data format of %q", trunc(string(content), 80))
+}
+
+func unmarshalJSON(content []byte) (interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal(content, &v); err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("JSON content is not an object")
+	}
+	return m, nil
+}
+
+func unmarshalYAML(content []byte) (interface{}, error) {
+	var v map[string]interface{}
+	if err := yaml.Unmarshal(content, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func unmarshalTOML(content []byte) (interface{}, error) {
+	var v map[string]interface{}
+	if err := toml.Unmarshal(content, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func unmarshalCSV(content []byte, opts unmarshalOptions) (interface{}, error) {
+	delimiter := opts.Delimiter
+	if delimiter == "" {
+		delimiter = ","
+	}
+
+	r := csv.NewReader(bytes.NewReader(content))
+	r.Comma = rune(delimiter[0])
+	if opts.Comment != "" {
+		r.Comment = rune(opts.Comment[0])
+	}
+	r.FieldsPerRecord = -1
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func md5String(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func looksLikeXML(content []byte) bool {
+	trimmed := bytes.TrimSpace(content)
+	return bytes.HasPrefix(trimmed, []byte("<"))
+}
+
+func trunc(s string, n int) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,347 @@
+// Copyright 2018 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// calendarComponentTypes enumerates the iCalendar/vCard component kinds that
+// are always exposed as a slice of maps, even when only one is present, so
+// templates can safely `range` over them.
+var calendarComponentTypes = map[string]bool{
+	"VEVENT":   true,
+	"VTODO":    true,
+	"VALARM":   true,
+	"VJOURNAL": true,
+}
+
+// unmarshalCalendar decodes an iCalendar (RFC 5545) or vCard payload into a
+// map[string]interface{}. Top-level properties (e.g. VERSION, PRODID,
+// X-WR-CALNAME) become string keys, and nested components (VEVENT, VTODO,
+// VALARM, ...) become []map[string]interface{} so they can be ranged over
+// uniformly regardless of how many are present.
+//
+// DTSTART/DTEND/DTSTAMP style values are parsed into time.Time, using opts.
+// Location to interpret floating (timezone-less) timestamps. If
+// opts.ExpandRecurring is set, VEVENTs carrying an RRULE are expanded into
+// additional synthetic VEVENT occurrences up to opts.WindowEnd.
+func unmarshalCalendar(content []byte, opts unmarshalOptions) (interface{}, error) {
+	loc, err := time.LoadLocation(opts.Location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid location %q: %s", opts.Location, err)
+	}
+
+	var windowEnd time.Time
+	if opts.WindowEnd != "" {
+		windowEnd, err = time.Parse(time.RFC3339, opts.WindowEnd)
+		if err != nil {
+			return nil, fmt.Errorf("invalid windowEnd %q, expected RFC3339: %s", opts.WindowEnd, err)
+		}
+	}
+
+	lines, err := unfoldCalendarLines(content)
+	if err != nil {
+		return nil, err
+	}
+
+	root := make(map[string]interface{})
+	stack := []map[string]interface{}{root}
+	sawBegin := false
+
+	for _, line := range lines {
+		name, params, value, err := splitCalendarLine(line)
+		if err != nil {
+			return nil, err
+		}
+
+		switch name {
+		case "BEGIN":
+			sawBegin = true
+			comp := make(map[string]interface{})
+			comp["component"] = value
+			stack = append(stack, comp)
+		case "END":
+			if len(stack) < 2 {
+				return nil, fmt.Errorf("unexpected END:%s without matching BEGIN", value)
+			}
+			comp := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			parent := stack[len(stack)-1]
+
+			upper := strings.ToUpper(value)
+
+			switch {
+			case len(stack) == 1 && (upper == "VCALENDAR" || upper == "VCARD"):
+				// The mandatory outermost VCALENDAR/VCARD wrapper isn't a
+				// "component" from a template's point of view; promote its
+				// properties (VERSION, the VEVENTs/VTODOs/... slices, ...)
+				// straight onto root instead of nesting everything under
+				// e.g. root["VCALENDAR"].
+				for k, v := range comp {
+					if k == "component" {
+						continue
+					}
+					parent[k] = v
+				}
+			case calendarComponentTypes[upper]:
+				key := upper + "s"
+				existing, _ := parent[key].([]map[string]interface{})
+				parent[key] = append(existing, comp)
+			default:
+				parent[value] = comp
+			}
+		default:
+			cur := stack[len(stack)-1]
+			cur[name] = decodeCalendarValue(name, params, value, loc)
+		}
+	}
+
+	if !sawBegin {
+		return nil, fmt.Errorf("not a valid iCalendar/vCard payload: missing BEGIN component")
+	}
+	if len(stack) != 1 {
+		return nil, fmt.Errorf("unbalanced BEGIN/END in iCalendar/vCard payload")
+	}
+
+	if opts.ExpandRecurring {
+		if events, ok := root["VEVENTs"].([]map[string]interface{}); ok {
+			root["VEVENTs"] = expandRecurringEvents(events, windowEnd)
+		}
+	}
+
+	return root, nil
+}
+
+// unfoldCalendarLines joins continuation lines (RFC 5545 "line folding",
+// where a leading space or tab on a line means it's a continuation of the
+// previous one) and drops blank lines.
+func unfoldCalendarLines(content []byte) ([]string, error) {
+	var lines []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		raw := strings.TrimRight(scanner.Text(), "\r")
+		if raw == "" {
+			continue
+		}
+		if (raw[0] == ' ' || raw[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += raw[1:]
+			continue
+		}
+		lines = append(lines, raw)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("empty iCalendar/vCard payload")
+	}
+
+	return lines, nil
+}
+
+// splitCalendarLine splits a "NAME;PARAM=VALUE;...:VALUE" content line into
+// its name, parameters and value.
+func splitCalendarLine(line string) (name string, params map[string]string, value string, err error) {
+	colon := strings.IndexByte(line, ':')
+	if colon < 0 {
+		return "", nil, "", fmt.Errorf("malformed content line, missing ':': %q", line)
+	}
+
+	head := line[:colon]
+	value = line[colon+1:]
+
+	parts := strings.Split(head, ";")
+	name = strings.ToUpper(parts[0])
+
+	if len(parts) > 1 {
+		params = make(map[string]string, len(parts)-1)
+		for _, p := range parts[1:] {
+			kv := strings.SplitN(p, "=", 2)
+			if len(kv) == 2 {
+				params[strings.ToUpper(kv[0])] = kv[1]
+			}
+		}
+	}
+
+	return name, params, value, nil
+}
+
+// decodeCalendarValue turns a raw property value into a time.Time for
+// date/date-time properties, or leaves it as a string otherwise.
+func decodeCalendarValue(name string, params map[string]string, value string, loc *time.Location) interface{} {
+	switch name {
+	case "DTSTART", "DTEND", "DTSTAMP", "RECURRENCE-ID", "CREATED", "LAST-MODIFIED":
+		if t, ok := parseCalendarTime(value, params, loc); ok {
+			return t
+		}
+	}
+
+	return value
+}
+
+func parseCalendarTime(value string, params map[string]string, loc *time.Location) (time.Time, bool) {
+	if params["VALUE"] == "DATE" || (len(value) == 8 && !strings.Contains(value, "T")) {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, err == nil
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, err == nil
+	}
+
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, err == nil
+}
+
+// expandRecurringEvents expands every VEVENT carrying an RRULE into
+// additional synthetic occurrences, each a shallow copy of the original
+// with DTSTART/DTEND shifted, stopping at windowEnd (or RRULE's own
+// COUNT/UNTIL, whichever comes first) to avoid runaway expansions for
+// open-ended rules.
+func expandRecurringEvents(events []map[string]interface{}, windowEnd time.Time) []map[string]interface{} {
+	var out []map[string]interface{}
+
+	for _, evt := range events {
+		out = append(out, evt)
+
+		rrule, ok := evt["RRULE"].(string)
+		if !ok || rrule == "" {
+			continue
+		}
+		start, ok := evt["DTSTART"].(time.Time)
+		if !ok {
+			continue
+		}
+
+		rule := parseRRule(rrule)
+		if !supportedRRuleFreq[rule.freq] {
+			// FREQ is either missing or one we don't know how to advance
+			// (e.g. HOURLY/MINUTELY/SECONDLY). rule.next would return
+			// its input unchanged, which would spin the loop below
+			// forever, so skip expansion entirely rather than risk that.
+			continue
+		}
+
+		occurrence := start
+		count := 1
+		for {
+			occurrence = rule.next(occurrence)
+
+			if rule.count > 0 && count >= rule.count {
+				break
+			}
+			if !rule.until.IsZero() && occurrence.After(rule.until) {
+				break
+			}
+			if !windowEnd.IsZero() && occurrence.After(windowEnd) {
+				break
+			}
+			if windowEnd.IsZero() && rule.until.IsZero() && rule.count == 0 {
+				// No cutoff was given for an open-ended rule; refuse to
+				// expand indefinitely.
+				break
+			}
+
+			clone := make(map[string]interface{}, len(evt))
+			for k, v := range evt {
+				clone[k] = v
+			}
+			clone["DTSTART"] = occurrence
+			if end, ok := evt["DTEND"].(time.Time); ok {
+				clone["DTEND"] = end.Add(occurrence.Sub(start))
+			}
+			clone["RECURRENCE-ID"] = occurrence
+
+			out = append(out, clone)
+			count++
+		}
+	}
+
+	return out
+}
+
+type rrule struct {
+	freq     string
+	interval int
+	count    int
+	until    time.Time
+}
+
+// supportedRRuleFreq lists the FREQ values rrule.next knows how to
+// advance. Anything else (HOURLY, MINUTELY, SECONDLY, or a missing/
+// malformed FREQ) must be treated as unsupported rather than expanded.
+var supportedRRuleFreq = map[string]bool{
+	"DAILY":   true,
+	"WEEKLY":  true,
+	"MONTHLY": true,
+	"YEARLY":  true,
+}
+
+func (r rrule) next(t time.Time) time.Time {
+	switch r.freq {
+	case "DAILY":
+		return t.AddDate(0, 0, r.interval)
+	case "WEEKLY":
+		return t.AddDate(0, 0, 7*r.interval)
+	case "MONTHLY":
+		return t.AddDate(0, r.interval, 0)
+	case "YEARLY":
+		return t.AddDate(r.interval, 0, 0)
+	default:
+		return t
+	}
+}
+
+// parseRRule parses the handful of RRULE parts needed for bounded
+// expansion (FREQ, INTERVAL, COUNT, UNTIL). Unsupported parts (BYDAY,
+// BYMONTH, ...) are ignored rather than rejected.
+func parseRRule(s string) rrule {
+	r := rrule{interval: 1}
+
+	for _, part := range strings.Split(s, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key, val := strings.ToUpper(kv[0]), kv[1]
+
+		switch key {
+		case "FREQ":
+			r.freq = strings.ToUpper(val)
+		case "INTERVAL":
+			if n, err := strconv.Atoi(val); err == nil && n > 0 {
+				r.interval = n
+			}
+		case "COUNT":
+			if n, err := strconv.Atoi(val); err == nil {
+				r.count = n
+			}
+		case "UNTIL":
+			if t, ok := parseCalendarTime(val, nil, time.UTC); ok {
+				r.until = t
+			}
+		}
+	}
+
+	return r
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// regoValidator validates decoded Unmarshal results against a compiled
+// Rego policy. The policy is expected to define a `deny` rule (a set or
+// array of strings) under its package; any non-empty result fails
+// validation, with the deny messages surfaced verbatim since Rego has no
+// equivalent of a JSON pointer to offer.
+type regoValidator struct {
+	query rego.PreparedEvalQuery
+}
+
+func newRegoValidator(content []byte) (Validator, error) {
+	module, err := ast.ParseModule("schema.rego", string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Rego policy: %s", err)
+	}
+
+	// The policy can declare whatever package name it likes (the request
+	// itself implies a per-data-file policy, e.g. "package authors"), so
+	// the deny query must be derived from the parsed module rather than
+	// assumed to live under a fixed package.
+	denyQuery := module.Package.Path.String() + ".deny"
+
+	r := rego.New(
+		rego.Query(denyQuery),
+		rego.ParsedModule(module),
+	)
+
+	query, err := r.PrepareForEval(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile Rego policy: %s", err)
+	}
+
+	return regoValidator{query: query}, nil
+}
+
+func (r regoValidator) Validate(v interface{}) error {
+	rs, err := r.query.Eval(context.Background(), rego.EvalInput(v))
+	if err != nil {
+		return fmt.Errorf("failed to evaluate Rego policy: %s", err)
+	}
+
+	var denials []string
+	for _, result := range rs {
+		for _, expr := range result.Expressions {
+			vals, ok := expr.Value.([]interface{})
+			if !ok {
+				continue
+			}
+			for _, val := range vals {
+				if msg, ok := val.(string); ok {
+					denials = append(denials, msg)
+				}
+			}
+		}
+	}
+
+	if len(denials) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("data does not conform to policy:\n%s", strings.Join(denials, "\n"))
+}
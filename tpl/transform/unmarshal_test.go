@@ -18,6 +18,7 @@ import (
 	"math/rand"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gohugoio/hugo/common/hugio"
 
@@ -136,6 +137,26 @@ a;b;c`, mime: media.CSVType}, map[string]interface{}{"DElimiter": ";", "Comment"
 			assert.Equal(r, [][]string{[]string{"a", "b", "c"}})
 
 		}},
+		{testContentResource{key: "r1", content: `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+UID:1@example.org
+DTSTART:20200101T090000
+SUMMARY:Daily standup
+END:VEVENT
+END:VCALENDAR
+`, mime: media.CalendarType}, nil, func(m map[string]interface{}) {
+			assert.Equal("2.0", m["VERSION"])
+			events, ok := m["VEVENTs"].([]map[string]interface{})
+			assert.True(ok)
+			assert.Equal(1, len(events))
+			assert.Equal("Daily standup", events[0]["SUMMARY"])
+		}},
+		{`<rss version="2.0"><channel><item><title>One</title></item></channel></rss>`, nil, func(m map[string]interface{}) {
+			rss, ok := m["rss"].(map[string]interface{})
+			assert.True(ok)
+			assert.Equal("2.0", rss["@version"])
+		}},
 		// errors
 		{"thisisnotavaliddataformat", nil, false},
 		{testContentResource{key: "r1", content: `invalid&toml"`, mime: media.TOMLType}, nil, false},
@@ -178,6 +199,158 @@ a;b;c`, mime: media.CSVType}, map[string]interface{}{"DElimiter": ";", "Comment"
 	}
 }
 
+func TestUnmarshalCalendarExpandRecurring(t *testing.T) {
+	assert := require.New(t)
+	v := viper.New()
+	ns := New(newDeps(v))
+
+	const ics = `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+UID:1@example.org
+DTSTART:20200101T090000
+DTEND:20200101T100000
+RRULE:FREQ=DAILY;COUNT=3
+SUMMARY:Daily standup
+END:VEVENT
+END:VCALENDAR
+`
+
+	result, err := ns.Unmarshal(map[string]interface{}{"expandRecurring": true}, ics)
+	assert.NoError(err)
+
+	m, ok := result.(map[string]interface{})
+	assert.True(ok)
+
+	events, ok := m["VEVENTs"].([]map[string]interface{})
+	assert.True(ok)
+	assert.Equal(3, len(events))
+
+	start0 := events[0]["DTSTART"].(time.Time)
+	start1 := events[1]["DTSTART"].(time.Time)
+	start2 := events[2]["DTSTART"].(time.Time)
+	assert.Equal(24*time.Hour, start1.Sub(start0))
+	assert.Equal(48*time.Hour, start2.Sub(start0))
+}
+
+// TestUnmarshalCalendarUnsupportedFrequencyDoesNotHang guards against the
+// RRULE expansion loop spinning forever when FREQ is one rrule.next
+// doesn't know how to advance (HOURLY/MINUTELY/SECONDLY) and windowEnd is
+// the only cutoff in play.
+func TestUnmarshalCalendarUnsupportedFrequencyDoesNotHang(t *testing.T) {
+	assert := require.New(t)
+	v := viper.New()
+	ns := New(newDeps(v))
+
+	const ics = `BEGIN:VCALENDAR
+BEGIN:VEVENT
+DTSTART:20200101T090000
+RRULE:FREQ=MINUTELY
+SUMMARY:Unsupported frequency
+END:VEVENT
+END:VCALENDAR
+`
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := ns.Unmarshal(map[string]interface{}{
+			"expandRecurring": true,
+			"windowEnd":       "2020-01-02T00:00:00Z",
+		}, ics)
+		assert.NoError(err)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Unmarshal did not return; an unsupported RRULE FREQ likely spun the expansion loop forever")
+	}
+}
+
+func TestUnmarshalXMLForceList(t *testing.T) {
+	assert := require.New(t)
+	v := viper.New()
+	ns := New(newDeps(v))
+
+	const xmlDoc = `<rss version="2.0"><channel><item><title>One</title></item></channel></rss>`
+
+	result, err := ns.Unmarshal(map[string]interface{}{"forceList": []string{"item"}}, xmlDoc)
+	assert.NoError(err)
+
+	m := result.(map[string]interface{})
+	rss := m["rss"].(map[string]interface{})
+	channel := rss["channel"].(map[string]interface{})
+
+	items, ok := channel["item"].([]interface{})
+	assert.True(ok, "forceList should decode a single <item> as a list")
+	assert.Equal(1, len(items))
+}
+
+func TestUnmarshalWithJSONSchema(t *testing.T) {
+	assert := require.New(t)
+	v := viper.New()
+	ns := New(newDeps(v))
+
+	const schema = `{
+		"type": "object",
+		"required": ["name"],
+		"properties": {"name": {"type": "string"}}
+	}`
+
+	_, err := ns.Unmarshal(map[string]interface{}{"schema": schema}, `{"name": "Ford"}`)
+	assert.NoError(err)
+
+	_, err = ns.Unmarshal(map[string]interface{}{"schema": schema}, `{"age": 3}`)
+	assert.Error(err)
+	assert.Contains(err.Error(), "name")
+}
+
+func TestUnmarshalWithRegoPolicy(t *testing.T) {
+	assert := require.New(t)
+	v := viper.New()
+	ns := New(newDeps(v))
+
+	// The policy deliberately uses its own package name, not "hugo", to
+	// cover the case where the deny query must be derived from the
+	// policy rather than assumed.
+	const policy = `package authors
+
+deny[msg] {
+	not input.name
+	msg := "name is required"
+}`
+
+	_, err := ns.Unmarshal(map[string]interface{}{"schema": policy}, `{"name": "Ford"}`)
+	assert.NoError(err)
+
+	_, err = ns.Unmarshal(map[string]interface{}{"schema": policy}, `{"age": 3}`)
+	assert.Error(err)
+	assert.Contains(err.Error(), "name is required")
+}
+
+// TestUnmarshalSchemaCacheKeyIncludesOptions guards against a decoded
+// result cached from a call without a "schema" option being handed back,
+// unvalidated, to a later call against the same data that does pass one.
+func TestUnmarshalSchemaCacheKeyIncludesOptions(t *testing.T) {
+	assert := require.New(t)
+	v := viper.New()
+	ns := New(newDeps(v))
+
+	const data = `{"name": ""}`
+	const schema = `{
+		"type": "object",
+		"required": ["name"],
+		"properties": {"name": {"type": "string", "minLength": 1}}
+	}`
+
+	_, err := ns.Unmarshal(data)
+	assert.NoError(err)
+
+	_, err = ns.Unmarshal(map[string]interface{}{"schema": schema}, data)
+	assert.Error(err)
+}
+
 func BenchmarkUnmarshalString(b *testing.B) {
 	v := viper.New()
 	ns := New(newDeps(v))
@@ -0,0 +1,139 @@
+// Copyright 2018 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+
+	"github.com/gohugoio/hugo/resource"
+)
+
+// Validator is the pluggable interface schema-checkers for Unmarshal
+// results must implement. It exists mainly so the built-in JSON Schema
+// and Rego validators (and any others) share one call site in Unmarshal.
+type Validator interface {
+	// Validate returns a descriptive error, including the JSON pointer of
+	// the offending node where possible, if v does not conform.
+	Validate(v interface{}) error
+}
+
+// getValidator resolves and compiles the "schema" option into a Validator,
+// caching the compiled result by the schema's resource key (or a hash of
+// its content for inline schemas) in ns.cache so repeated calls against
+// the same schema stay cheap.
+func (ns *Namespace) getValidator(schema interface{}) (Validator, error) {
+	cacheKey, content, err := schemaCacheKeyAndContent(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := ns.cache.GetOrCreate("schema/"+cacheKey, func() (interface{}, error) {
+		return newValidator(content)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(Validator), nil
+}
+
+// schemaCacheKeyAndContent normalizes the "schema" option, which may be a
+// Resource, a literal schema/policy string, or an already-decoded map
+// (typically built with the `dict` template func), into raw bytes plus a
+// stable cache key.
+func schemaCacheKeyAndContent(schema interface{}) (key string, content []byte, err error) {
+	switch v := schema.(type) {
+	case resource.ReadSeekCloserResource:
+		rc, err := v.ReadSeekCloser()
+		if err != nil {
+			return "", nil, err
+		}
+		defer rc.Close()
+		b := new(bytes.Buffer)
+		if _, err := b.ReadFrom(rc); err != nil {
+			return "", nil, err
+		}
+		return v.Key(), b.Bytes(), nil
+	case string:
+		return md5String(v), []byte(v), nil
+	case map[string]interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", nil, fmt.Errorf("schema is not valid JSON: %s", err)
+		}
+		return md5String(string(b)), b, nil
+	default:
+		return "", nil, fmt.Errorf("schema of type %T not supported, expected a string, a Resource or a map", schema)
+	}
+}
+
+// newValidator compiles content into a Validator, picking the JSON Schema
+// validator unless content looks like a Rego policy (i.e. starts with a
+// `package` declaration).
+func newValidator(content []byte) (Validator, error) {
+	if looksLikeRego(content) {
+		return newRegoValidator(content)
+	}
+	return newJSONSchemaValidator(content)
+}
+
+func looksLikeRego(content []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(content), []byte("package "))
+}
+
+type jsonSchemaValidator struct {
+	schema *gojsonschema.Schema
+}
+
+func newJSONSchemaValidator(content []byte) (Validator, error) {
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile JSON Schema: %s", err)
+	}
+	return jsonSchemaValidator{schema: schema}, nil
+}
+
+func (j jsonSchemaValidator) Validate(v interface{}) error {
+	result, err := j.schema.Validate(gojsonschema.NewGoLoader(v))
+	if err != nil {
+		return fmt.Errorf("failed to validate against schema: %s", err)
+	}
+
+	if result.Valid() {
+		return nil
+	}
+
+	var msgs []string
+	for _, re := range result.Errors() {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", toJSONPointer(re.Field()), re.Description()))
+	}
+
+	return fmt.Errorf("data does not conform to schema:\n%s", strings.Join(msgs, "\n"))
+}
+
+// toJSONPointer turns gojsonschema's dotted field path (e.g.
+// "(root).authors.0.name") into a JSON pointer (e.g. "/authors/0/name").
+func toJSONPointer(field string) string {
+	field = strings.TrimPrefix(field, "(root)")
+	field = strings.TrimPrefix(field, ".")
+	if field == "" {
+		return "/"
+	}
+	return "/" + strings.ReplaceAll(field, ".", "/")
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// unmarshalXML decodes an XML document into the same map[string]interface{}
+// shape produced by the JSON/YAML/TOML decoders, so existing templates
+// written against those formats keep working unchanged.
+//
+// Attributes are exposed as plain map entries prefixed with
+// opts.AttributePrefix (default "@") to keep them distinguishable from
+// child elements of the same name. Character data on an element that also
+// has attributes or children is stored under opts.TextKey (default
+// "#text"); otherwise the element collapses to its text value directly.
+//
+// XML can't tell a template whether an element repeats until a second one
+// shows up, which breaks `range` the first time a feed happens to have
+// exactly one item. Any element name listed in opts.ForceList always
+// decodes as a slice, even when only one is present.
+func unmarshalXML(content []byte, opts unmarshalOptions) (interface{}, error) {
+	forceList := make(map[string]bool, len(opts.ForceList))
+	for _, name := range opts.ForceList {
+		forceList[name] = true
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(content))
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode XML: %s", err)
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			root := make(map[string]interface{})
+			value, err := decodeXMLElement(dec, start, opts, forceList)
+			if err != nil {
+				return nil, err
+			}
+			root[start.Name.Local] = value
+			return root, nil
+		}
+	}
+}
+
+// decodeXMLElement decodes the children of start (whose opening token has
+// already been consumed) until its matching EndElement, returning either a
+// map[string]interface{} (if it has attributes, children or both), or a
+// plain string (if it's pure character data).
+func decodeXMLElement(dec *xml.Decoder, start xml.StartElement, opts unmarshalOptions, forceList map[string]bool) (interface{}, error) {
+	m := make(map[string]interface{})
+
+	for _, attr := range start.Attr {
+		m[opts.AttributePrefix+attr.Name.Local] = attr.Value
+	}
+
+	var text strings.Builder
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode XML: %s", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			child, err := decodeXMLElement(dec, t, opts, forceList)
+			if err != nil {
+				return nil, err
+			}
+			addXMLChild(m, t.Name.Local, child, forceList)
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			textValue := strings.TrimSpace(text.String())
+
+			if len(m) == 0 {
+				return textValue, nil
+			}
+			if textValue != "" {
+				m[opts.TextKey] = textValue
+			}
+			return m, nil
+		}
+	}
+}
+
+// addXMLChild stores a decoded child under its element name, promoting the
+// value to a []interface{} as soon as a second occurrence (or a forced
+// list name) is seen.
+func addXMLChild(m map[string]interface{}, name string, value interface{}, forceList map[string]bool) {
+	existing, ok := m[name]
+	if !ok {
+		if forceList[name] {
+			m[name] = []interface{}{value}
+		} else {
+			m[name] = value
+		}
+		return
+	}
+
+	if list, ok := existing.([]interface{}); ok {
+		m[name] = append(list, value)
+		return
+	}
+
+	m[name] = []interface{}{existing, value}
+}